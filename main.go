@@ -3,20 +3,64 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v2"
 )
 
+// RedirectHop records one hop of a (possibly multi-step) redirect chain.
+type RedirectHop struct {
+	Status   int
+	Location string
+	Elapsed  time.Duration
+}
+
 type reqRslt struct {
-	App        string
-	Accessible bool
-	Status     int
-	Notes      string
+	App           string
+	Accessible    bool
+	Status        int
+	Notes         string
+	StartedAt     time.Time
+	Duration      time.Duration
+	BytesRead     int
+	URL           string
+	Attempts      int
+	Redirects     []RedirectHop
+	ContentType   string
+	ContentLength int64
+	Title         string
+	Trace         *Trace
+}
+
+// Trace holds low-level timings for a single HTTP round trip: how long DNS
+// resolution, the TCP connect, and the TLS handshake took, plus the overall
+// time-to-first-byte. It's only populated when -debug-http is set, since
+// the httptrace hooks that fill it in add overhead not worth paying by
+// default.
+type Trace struct {
+	DNSLookup    time.Duration
+	TCPConnect   time.Duration
+	TLSHandshake time.Duration
+	TTFB         time.Duration
 }
 
 // fill is a method on reqRslt that populates the object with data
@@ -29,153 +73,578 @@ func (r *reqRslt) fill(app string, acc bool, st int, nts string) {
 }
 
 var (
-	err     error
-	args    []string
-	apps    []string
-	inFile  *os.File
-	scnr    *bufio.Scanner
-	results []reqRslt
-	wg      sync.WaitGroup
-	elm     *reqRslt
+	err          error
+	args         []string
+	apps         []string
+	inFile       *os.File
+	scnr         *bufio.Scanner
+	wg           sync.WaitGroup
+	sigFile      string
+	detectors    []Detector
+	format       string
+	outFile      string
+	concurrency  int
+	rps          float64
+	retries      int
+	backoffBase  time.Duration
+	backoffMax   time.Duration
+	maxRedirects int
+	noFollow     bool
+	method       string
+	maxBody      int64
+	timeout      time.Duration
+	deadline     time.Duration
+	maxPerHost   int
+	debugHTTP    bool
+	debugDir     string
+	dbgLogger    *debugLogger
 )
 
-// isHTML indicates if the response body is a web page
-func isHTML(b []byte) bool {
-	// Does the body contain an <html> and <body> tag?
-	if bytes.Contains(b, []byte("<html")) || bytes.Contains(b, []byte("<HTML")) {
-		// Return true if the body tag is present
-		return bytes.Contains(b, []byte("<body")) || bytes.Contains(b, []byte("<BODY"))
-	}
+// Detector classifies a page (its parsed PageInfo, raw body, associated
+// *http.Response, and the redirect chain that led to it) as belonging to a
+// known page/error signature. ok reports whether the detector recognized
+// the response at all; when ok is true, label and accessible describe the
+// classification.
+type Detector interface {
+	Match(info PageInfo, body []byte, resp *http.Response, redirects []RedirectHop) (label string, accessible bool, ok bool)
+}
 
-	// Did not find an <html> tag; return false
+// PageInfo holds the structured signals Analyze extracts from an HTML
+// document, so detectors classify against parsed structure instead of
+// fragile byte-substring checks.
+type PageInfo struct {
+	IsHTML       bool
+	Title        string
+	MetaRefresh  string
+	H1Text       string
+	HasForm      bool
+	Fingerprints []string
+}
+
+// hasFingerprint reports whether Analyze tagged the page with the named
+// fingerprint.
+func (p PageInfo) hasFingerprint(name string) bool {
+	for _, f := range p.Fingerprints {
+		if f == name {
+			return true
+		}
+	}
 	return false
 }
 
-// isHerokuErrPage indicates if the response body is a Heroku error page or welcome page
-func isHerokuErrPage(b []byte) bool {
+// Analyze parses body once with goquery and extracts the structured
+// signals used for classification: title, meta-refresh target, first H1,
+// whether a form is present, and any recognized framework fingerprints. A
+// body that doesn't parse as HTML yields a zero-value PageInfo.
+func Analyze(body []byte) PageInfo {
+	var info PageInfo
+
+	doc, derr := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if derr != nil {
+		return info
+	}
 
-	if bytes.Contains(b, []byte("www.herokucdn.com/error-pages/application-error.html")) {
-		// Assume the response is the Heroku Application Error page
+	info.IsHTML = doc.Find("html").Length() > 0 && doc.Find("body").Length() > 0
+	info.Title = strings.TrimSpace(doc.Find("title").First().Text())
+	info.H1Text = strings.TrimSpace(doc.Find("h1").First().Text())
+	info.HasForm = doc.Find("form").Length() > 0
+
+	doc.Find(`meta[http-equiv="refresh" i]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if content, ok := s.Attr("content"); ok {
+			info.MetaRefresh = content
+			return false
+		}
 		return true
+	})
+
+	// Heroku's stock error page has a fixed structure: a page titled
+	// "Application Error" with an <img> pulling its art from herokucdn.com's
+	// error-pages assets. Match on that structure rather than a whole-body
+	// byte search so a reworded error string or gzip-wrapped response
+	// doesn't slip past detection.
+	if strings.Contains(info.Title, "Application Error") && doc.Find(`img[src*="herokucdn.com/error-pages"]`).Length() > 0 {
+		info.Fingerprints = append(info.Fingerprints, "heroku-error-cdn")
+	}
+	if strings.Contains(info.Title, "Welcome to your new app") {
+		info.Fingerprints = append(info.Fingerprints, "heroku-welcome")
 	}
 
-	// No Heroku page "tell" was found
-	return false
+	// Avant's branded error page always renders its support phone number as
+	// paragraph text; scope the match to <p> elements via goquery instead
+	// of searching the raw body so unrelated script/style content can't
+	// produce a false positive.
+	doc.Find("p").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		t := s.Text()
+		if strings.Contains(t, "Call us at 800-712-5407") || strings.Contains(t, "Call us at 0800 610 1516") {
+			info.Fingerprints = append(info.Fingerprints, "avant-error")
+			return false
+		}
+		return true
+	})
+	if strings.Contains(info.Title, "Welcome to nginx!") {
+		info.Fingerprints = append(info.Fingerprints, "nginx-default")
+	}
+	if strings.Contains(info.Title, "Action Controller: Exception caught") || bytes.Contains(body, []byte("Routing Error")) {
+		info.Fingerprints = append(info.Fingerprints, "rails-default")
+	}
+
+	return info
 }
 
-// isHerokuWelPage indicates if the response body is a Heroku error page or welcome page
-func isHerokuWelPage(b []byte) bool {
+// avantErrDetector recognizes the Avant-branded application error page
+type avantErrDetector struct{}
 
-	if bytes.Contains(b, []byte("Welcome to your new app")) {
-		// Assume the response is the Heroku Welcome page
-		return true
+func (d avantErrDetector) Match(info PageInfo, body []byte, resp *http.Response, redirects []RedirectHop) (string, bool, bool) {
+	if info.hasFingerprint("avant-error") {
+		return "Avant error page", false, true
 	}
 
-	// No Heroku page "tell" was found
-	return false
+	return "", false, false
 }
 
-// isAvantErrPage indicates if the response body is a Heroku error page or welcome page
-func isAvantErrPage(b []byte) bool {
+// herokuErrDetector recognizes the stock Heroku application error page
+type herokuErrDetector struct{}
 
-	if bytes.Contains(b, []byte("We have been notified, please try again later. Have a question? Call us at 800-712-5407")) {
-		// Assume the response is the Heroku Welcome page
-		return true
+func (d herokuErrDetector) Match(info PageInfo, body []byte, resp *http.Response, redirects []RedirectHop) (string, bool, bool) {
+	if info.hasFingerprint("heroku-error-cdn") {
+		return "Heroku error page", false, true
 	}
 
-	if bytes.Contains(b, []byte("We have been notified, please try again later. Have a question? Call us at 0800 610 1516")) {
-		// Assume the response is the Heroku Welcome page
-		return true
+	return "", false, false
+}
+
+// herokuWelDetector recognizes the stock Heroku "new app" welcome page
+type herokuWelDetector struct{}
+
+func (d herokuWelDetector) Match(info PageInfo, body []byte, resp *http.Response, redirects []RedirectHop) (string, bool, bool) {
+	if info.hasFingerprint("heroku-welcome") {
+		return "Heroku welcome page", false, true
 	}
 
-	// No Heroku page "tell" was found
-	return false
+	return "", false, false
 }
 
-// procApp executes an HTTP GET on a passed Heroku app and does some rudimentary analysis
-func procApp(site string, c chan *reqRslt) {
+// herokuRedirectErrDetector flags apps whose redirect chain bounces through
+// what looks like a Heroku maintenance/error host, even when the final
+// body renders as ordinary HTML
+type herokuRedirectErrDetector struct{}
+
+func (d herokuRedirectErrDetector) Match(info PageInfo, body []byte, resp *http.Response, redirects []RedirectHop) (string, bool, bool) {
+	for _, hop := range redirects {
+		if !strings.Contains(hop.Location, "herokuapp.com") {
+			continue
+		}
+		if strings.Contains(hop.Location, "error") || strings.Contains(hop.Location, "maintenance") {
+			return fmt.Sprintf("redirected to Heroku error host: %v", hop.Location), false, true
+		}
+	}
+
+	return "", false, false
+}
+
+// SignatureRule describes a single user-supplied detection rule loaded from
+// a signature file. A rule matches when the response status (if set) agrees
+// and at least one of Contains/Regexes is found in the body.
+type SignatureRule struct {
+	Name       string   `yaml:"name" json:"name"`
+	Accessible bool     `yaml:"accessible" json:"accessible"`
+	Status     int      `yaml:"status" json:"status"`
+	Contains   []string `yaml:"contains" json:"contains"`
+	Regexes    []string `yaml:"regexes" json:"regexes"`
+}
+
+// SignatureDetector matches responses against user-provided rules, letting
+// operators extend detection for new PaaS providers or their own error
+// pages without recompiling.
+type SignatureDetector struct {
+	rules    []SignatureRule
+	compiled [][]*regexp.Regexp
+}
+
+// loadSignatureFile reads a YAML or JSON signature file (selected by file
+// extension) and returns a ready-to-use SignatureDetector.
+func loadSignatureFile(path string) (*SignatureDetector, error) {
 	var (
-		ferr       error
-		resp       *http.Response
-		tReslt     reqRslt
-		tURL, tStr string
-		body       []byte
-		tLen       = 50
+		ferr  error
+		raw   []byte
+		rules []SignatureRule
 	)
 
-	// Remember to decrement the goroutine counter
-	defer wg.Done()
+	if raw, ferr = ioutil.ReadFile(path); ferr != nil {
+		return nil, fmt.Errorf("error reading signature file: %v", ferr)
+	}
 
-	// Have a non-empty string parameter?
-	if len(site) == 0 {
-		// No site is being requested
-		tReslt.fill(site, false, 999, "no site name was provided")
-		goto WrapUp
+	if strings.HasSuffix(path, ".json") {
+		if ferr = json.Unmarshal(raw, &rules); ferr != nil {
+			return nil, fmt.Errorf("error parsing JSON signature file: %v", ferr)
+		}
+	} else {
+		if ferr = yaml.Unmarshal(raw, &rules); ferr != nil {
+			return nil, fmt.Errorf("error parsing YAML signature file: %v", ferr)
+		}
 	}
 
-	// Execute a GET on the Heroku app domain
-	tURL = fmt.Sprintf("http://%v.herokuapp.com", site)
-	resp, ferr = http.Get(tURL)
+	d := &SignatureDetector{rules: rules, compiled: make([][]*regexp.Regexp, len(rules))}
+	for i, rule := range rules {
+		for _, pattern := range rule.Regexes {
+			re, rerr := regexp.Compile(pattern)
+			if rerr != nil {
+				return nil, fmt.Errorf("error compiling regex %q for rule %q: %v", pattern, rule.Name, rerr)
+			}
+			d.compiled[i] = append(d.compiled[i], re)
+		}
+	}
 
-	// General error when executing the HTTP GET?
-	if ferr != nil {
-		// EOF error? (no data in the response)
-		if strings.Contains(ferr.Error(), "EOF") {
-			// No data returned in the response
-			tReslt.fill(site, false, 999, fmt.Sprintf("no response data: %v", ferr))
-			goto WrapUp
+	return d, nil
+}
+
+// Match implements Detector for SignatureDetector
+func (d *SignatureDetector) Match(info PageInfo, body []byte, resp *http.Response, redirects []RedirectHop) (string, bool, bool) {
+	for i, rule := range d.rules {
+		if rule.Status != 0 && resp != nil && resp.StatusCode != rule.Status {
+			continue
+		}
+
+		matched := false
+		for _, s := range rule.Contains {
+			if bytes.Contains(body, []byte(s)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			for _, re := range d.compiled[i] {
+				if re.Match(body) {
+					matched = true
+					break
+				}
+			}
 		}
 
-		// Certificate error?
-		if strings.Contains(ferr.Error(), "x509: certificate is valid for") {
-			// No data returned in the response
-			tReslt.fill(site, false, 200, fmt.Sprintf("SSL certificate error: %v", ferr))
-			goto WrapUp
+		if matched {
+			return rule.Name, rule.Accessible, true
 		}
+	}
+
+	return "", false, false
+}
+
+
+// hopRecordingTransport wraps an http.RoundTripper, appending a RedirectHop
+// for every response it sees (not just the final one), so the full chain
+// a request travels through is visible afterward.
+type hopRecordingTransport struct {
+	rt   http.RoundTripper
+	hops *[]RedirectHop
+}
 
-		// Error occurred during the request
-		fmt.Printf("ERROR: error occurred fetching: %v. See: %v", tURL, ferr)
-		tReslt.fill(site, false, 999, fmt.Sprintf("error getting site response: %v", ferr))
-		goto WrapUp
+func (t *hopRecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, rerr := t.rt.RoundTrip(req)
+	if rerr != nil {
+		return resp, rerr
 	}
 
-	// Inspect the response body
+	*t.hops = append(*t.hops, RedirectHop{
+		Status:   resp.StatusCode,
+		Location: resp.Header.Get("Location"),
+		Elapsed:  time.Since(start),
+	})
+
+	return resp, rerr
+}
+
+// newProbeClient builds an *http.Client that records every hop of a
+// request's redirect chain into redirects. When noFollow is set the client
+// stops at the first response (via http.ErrUseLastResponse); otherwise it
+// follows up to max redirects and fails with an error past that.
+func newProbeClient(redirects *[]RedirectHop, max int, noFollow bool) *http.Client {
+	return &http.Client{
+		Transport: &hopRecordingTransport{rt: http.DefaultTransport, hops: redirects},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if noFollow {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= max {
+				return fmt.Errorf("stopped after %d redirects", max)
+			}
+			return nil
+		},
+	}
+}
+
+// debugLogRotateSize is the approximate size, in bytes, a -debug-http log
+// file is allowed to reach before debugLogger rotates to a new one.
+const debugLogRotateSize = 50 * 1024 * 1024
+
+// debugLogger is an io.Writer that spreads -debug-http dumps across a
+// directory of numbered log files, rotating to the next one once the
+// current file passes debugLogRotateSize, so a long run doesn't pile
+// everything into one unbounded file.
+type debugLogger struct {
+	mu      sync.Mutex
+	dir     string
+	cur     *os.File
+	written int64
+	index   int
+}
+
+// newDebugLogger creates dir if needed and returns a debugLogger that
+// writes rotating log files into it.
+func newDebugLogger(dir string) (*debugLogger, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &debugLogger{dir: dir}, nil
+}
+
+// rotate closes the current log file, if any, and opens the next one.
+// Callers must hold d.mu.
+func (d *debugLogger) rotate() error {
+	if d.cur != nil {
+		d.cur.Close()
+	}
+
+	d.index++
+	f, rerr := os.Create(filepath.Join(d.dir, fmt.Sprintf("debug-%03d.log", d.index)))
+	if rerr != nil {
+		return rerr
+	}
+
+	d.cur = f
+	d.written = 0
+	return nil
+}
+
+// Write implements io.Writer, rotating to a fresh file first if the
+// current one is full or not yet open.
+func (d *debugLogger) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cur == nil || d.written >= debugLogRotateSize {
+		if rerr := d.rotate(); rerr != nil {
+			return 0, rerr
+		}
+	}
+
+	n, werr := d.cur.Write(p)
+	d.written += int64(n)
+	return n, werr
+}
+
+// debugRedactHeaders matches Authorization/Cookie header lines in an
+// httputil dump so their values never reach the debug log.
+var debugRedactHeaders = regexp.MustCompile(`(?im)^(Authorization|Cookie):.*$`)
+
+// redactDump returns dump with Authorization/Cookie header values replaced,
+// leaving the rest of the request/response dump intact.
+func redactDump(dump []byte) []byte {
+	return debugRedactHeaders.ReplaceAll(dump, []byte("$1: [redacted]"))
+}
+
+// newClientTrace builds an httptrace.ClientTrace that records DNS, TCP
+// connect, and TLS handshake durations plus time-to-first-byte (measured
+// from start) into trace.
+func newClientTrace(trace *Trace, start time.Time) *httptrace.ClientTrace {
+	var dnsStart, connectStart, tlsStart time.Time
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			trace.DNSLookup = time.Since(dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			trace.TCPConnect = time.Since(connectStart)
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			trace.TLSHandshake = time.Since(tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			trace.TTFB = time.Since(start)
+		},
+	}
+}
+
+// isHTMLishContentType reports whether a Content-Type header value looks
+// like it holds an HTML document (or is absent, which we give the benefit
+// of the doubt since plenty of misconfigured apps omit it).
+func isHTMLishContentType(ct string) bool {
+	ct = strings.ToLower(ct)
+	return ct == "" || strings.Contains(ct, "text/html") || strings.Contains(ct, "application/xhtml+xml")
+}
+
+// doRequest issues a single method request through client, without following
+// the convenience helpers (client.Get etc.) that hard-code GET. ctx carries
+// the -timeout/-deadline budget so a slow or hung upstream gets cancelled
+// instead of blocking a worker forever. When trace is non-nil (-debug-http),
+// the request is wired up with httptrace hooks and a redacted
+// request/response dump is written to dbgLogger.
+func doRequest(ctx context.Context, client *http.Client, method, url, site string, trace *Trace) (*http.Response, error) {
+	if trace != nil {
+		ctx = httptrace.WithClientTrace(ctx, newClientTrace(trace, time.Now()))
+	}
+
+	req, rerr := http.NewRequestWithContext(ctx, method, url, nil)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	if dbgLogger != nil {
+		if dump, derr := httputil.DumpRequestOut(req, true); derr == nil {
+			fmt.Fprintf(dbgLogger, "=== request: %s %s (%s) ===\n%s\n", method, url, site, redactDump(dump))
+		}
+	}
+
+	resp, derr := client.Do(req)
+	if derr != nil {
+		return resp, derr
+	}
+
+	if dbgLogger != nil {
+		if dump, derr := httputil.DumpResponse(resp, true); derr == nil {
+			fmt.Fprintf(dbgLogger, "=== response: %s %s (%s) ===\n%s\n", method, url, site, redactDump(dump))
+		}
+	}
+
+	return resp, derr
+}
+
+// fillTransportError classifies a transport-level error (DNS, TLS, too many
+// redirects, etc.) onto tReslt.
+func fillTransportError(tReslt *reqRslt, site, tURL string, ferr error) {
+	// Per-request -timeout (or the overall -deadline) expired mid-request?
+	if errors.Is(ferr, context.DeadlineExceeded) {
+		tReslt.fill(site, false, 999, "deadline exceeded")
+		return
+	}
+
+	// EOF error? (no data in the response)
+	if strings.Contains(ferr.Error(), "EOF") {
+		tReslt.fill(site, false, 999, fmt.Sprintf("no response data: %v", ferr))
+		return
+	}
+
+	// Certificate error?
+	if strings.Contains(ferr.Error(), "x509: certificate is valid for") {
+		tReslt.fill(site, false, 200, fmt.Sprintf("SSL certificate error: %v", ferr))
+		return
+	}
+
+	// Too many redirects?
+	if strings.Contains(ferr.Error(), "stopped after") {
+		tReslt.fill(site, false, 999, fmt.Sprintf("RedirectError: %v", ferr))
+		return
+	}
+
+	// Error occurred during the request
+	fmt.Printf("ERROR: error occurred fetching: %v. See: %v", tURL, ferr)
+	tReslt.fill(site, false, 999, fmt.Sprintf("error getting site response: %v", ferr))
+}
+
+// classifyHeadersOnly classifies a response using only its headers, either
+// because the probe method is HEAD-only or because -method smart decided
+// the body wasn't worth downloading.
+func classifyHeadersOnly(site string, resp *http.Response, tReslt *reqRslt) {
+	nts := fmt.Sprintf("content-type %q, content-length %v (body not fetched)", tReslt.ContentType, tReslt.ContentLength)
+
+	// In -no-follow mode a redirect comes back verbatim rather than chasing
+	// the Location header; flag that explicitly instead of reporting it as
+	// a generically accessible response, matching classifyBody's GET path
+	if noFollow && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		tReslt.fill(site, false, resp.StatusCode, fmt.Sprintf("RedirectError: %d redirect to %v (not followed)", resp.StatusCode, resp.Header.Get("Location")))
+		return
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		tReslt.fill(site, true, resp.StatusCode, nts)
+		return
+	}
+
+	tReslt.fill(site, false, resp.StatusCode, nts)
+}
+
+// readLimitedBody reads up to max+1 bytes from r so callers can tell whether
+// the real body would have exceeded max, without ever buffering an
+// arbitrarily large response into memory to find out.
+func readLimitedBody(r io.Reader, max int64) (body []byte, truncated bool, err error) {
+	body, err = ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return body, false, err
+	}
+
+	if int64(len(body)) > max {
+		return body[:max], true, nil
+	}
+
+	return body, false, nil
+}
+
+// classifyBody reads resp's body (capped at -max-body bytes), parses it
+// once via Analyze, and runs the result through the detector pipeline,
+// falling back to a generic HTML check and a body-snippet dump.
+func classifyBody(site string, resp *http.Response, tReslt *reqRslt) {
+	var (
+		ferr error
+		body []byte
+		tStr string
+		tLen = 50
+	)
+
 	defer resp.Body.Close() // Ensure the response body gets closed
 
-	// Read the response body
-	if body, ferr = ioutil.ReadAll(resp.Body); ferr != nil {
+	// Read the response body, bailing out instead of buffering the whole
+	// thing if it's larger than -max-body
+	body, truncated, ferr := readLimitedBody(resp.Body, maxBody)
+	if ferr != nil {
 		// Error occurred reading a response body
 		fmt.Printf("ERROR: error occurred reading a response body for site: %v. See: %v\n", site, ferr)
 		tReslt.fill(site, false, 999, fmt.Sprintf("error reading the site response: %v", ferr))
-		goto WrapUp
+		tReslt.BytesRead = len(body)
+		return
 	}
+	tReslt.BytesRead = len(body)
 
-	// Is the response the Avant Application Error?
-	if isAvantErrPage(body) {
-		// Found a Heroku page
-		tReslt.fill(site, false, resp.StatusCode, "Avant error page")
-		goto WrapUp
+	if truncated {
+		tReslt.fill(site, true, resp.StatusCode, fmt.Sprintf("body exceeded -max-body (%d bytes), not classified", maxBody))
+		return
 	}
 
-	// Is the response the Heroku Error page?
-	if isHerokuErrPage(body) {
-		// Found a Heroku page
-		tReslt.fill(site, false, resp.StatusCode, "Heroku error page")
-		goto WrapUp
+	// Parse the body once and reuse the extracted info for both the title
+	// column and the detector pipeline below
+	info := Analyze(body)
+	tReslt.Title = info.Title
+
+	// In -no-follow mode a redirect comes back verbatim rather than chasing
+	// the Location header; flag that explicitly instead of classifying
+	// whatever tiny placeholder body came with it
+	if noFollow && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		tReslt.fill(site, false, resp.StatusCode, fmt.Sprintf("RedirectError: %d redirect to %v (not followed)", resp.StatusCode, resp.Header.Get("Location")))
+		return
 	}
 
-	// Is the response the Heroku Welcome page?
-	if isHerokuWelPage(body) {
-		// Found a Heroku page
-		tReslt.fill(site, false, resp.StatusCode, "Heroku welcome page")
-		goto WrapUp
+	// Run the response through the registered detectors
+	for _, d := range detectors {
+		if label, accessible, ok := d.Match(info, body, resp, tReslt.Redirects); ok {
+			tReslt.fill(site, accessible, resp.StatusCode, label)
+			return
+		}
 	}
 
 	// Find a web page?
-	if isHTML(body) {
+	if info.IsHTML {
 		// Found an HTML page
 		tReslt.fill(site, true, resp.StatusCode, "HTML page")
-		goto WrapUp
+		return
 	}
 
 	// Found something - not a Heroku page or generic web page
@@ -184,25 +653,497 @@ func procApp(site string, c chan *reqRslt) {
 	}
 	tStr = fmt.Sprintf("found this (first %v bytes): %v...", tLen, string(body[:tLen]))
 	tReslt.fill(site, true, resp.StatusCode, tStr)
+}
 
-WrapUp:
-	c <- &tReslt // Put a pointer to the result object on the channel
+// fetchSite probes a single Heroku app and does some rudimentary analysis.
+// Depending on -method it issues a plain GET, a HEAD-only request, or (in
+// "smart" mode) a HEAD followed by a conditional GET, escalating only when
+// the Content-Type looks like HTML and Content-Length is under -max-body.
+// It performs exactly one attempt; retry behavior lives in probeWithRetry.
+// The whole attempt (HEAD and GET alike) is bounded by -timeout and by
+// whatever remains of the parent ctx's -deadline budget. hl, if non-nil,
+// caps how many requests may be in flight against this site's hostname at
+// once.
+func fetchSite(ctx context.Context, site string, hl *hostLimiter) *reqRslt {
+	var (
+		ferr   error
+		resp   *http.Response
+		tReslt reqRslt
+		tURL   string
+	)
 
-	return
+	tReslt.StartedAt = time.Now()
+
+	// Populate timing info and hand the result back, regardless of how we got here
+	defer func() {
+		tReslt.Duration = time.Since(tReslt.StartedAt)
+		if resp != nil && resp.Request != nil {
+			tReslt.URL = resp.Request.URL.String()
+		}
+	}()
+
+	// Have a non-empty string parameter?
+	if len(site) == 0 {
+		// No site is being requested
+		tReslt.fill(site, false, 999, "no site name was provided")
+		return &tReslt
+	}
+
+	host := fmt.Sprintf("%v.herokuapp.com", site)
+	tURL = fmt.Sprintf("http://%v", host)
+	client := newProbeClient(&tReslt.Redirects, maxRedirects, noFollow)
+
+	if debugHTTP {
+		tReslt.Trace = &Trace{}
+	}
+
+	hl.acquire(host)
+	defer hl.release(host)
+
+	// Start the per-request timeout only after we hold a per-host slot, so
+	// time spent queued behind -max-per-host isn't charged against the
+	// request's own deadline.
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if method == "head" || method == "smart" {
+		if resp, ferr = doRequest(ctx, client, http.MethodHead, tURL, site, tReslt.Trace); ferr != nil {
+			fillTransportError(&tReslt, site, tURL, ferr)
+			return &tReslt
+		}
+		resp.Body.Close()
+
+		tReslt.ContentType = resp.Header.Get("Content-Type")
+		tReslt.ContentLength = resp.ContentLength
+
+		if method == "head" {
+			classifyHeadersOnly(site, resp, &tReslt)
+			return &tReslt
+		}
+
+		// smart mode: only escalate to GET when it looks like HTML worth fetching
+		if !isHTMLishContentType(tReslt.ContentType) || (tReslt.ContentLength >= 0 && tReslt.ContentLength > maxBody) {
+			classifyHeadersOnly(site, resp, &tReslt)
+			return &tReslt
+		}
+	}
+
+	// Execute a GET on the Heroku app domain, tracking the redirect chain
+	if resp, ferr = doRequest(ctx, client, http.MethodGet, tURL, site, tReslt.Trace); ferr != nil {
+		fillTransportError(&tReslt, site, tURL, ferr)
+		return &tReslt
+	}
+
+	tReslt.ContentType = resp.Header.Get("Content-Type")
+	tReslt.ContentLength = resp.ContentLength
+
+	classifyBody(site, resp, &tReslt)
+
+	return &tReslt
+}
+
+// isRetryable reports whether a fetchSite result represents a transient
+// failure worth retrying: network/transport errors and 5xx/408/429
+// responses. DNS NXDOMAIN, TLS certificate mismatches, a missing site
+// name, a stopped-redirect-chain note, and other 4xx responses are
+// deterministic outcomes that retrying cannot change, so they are
+// treated as permanent and are not retried.
+func isRetryable(r *reqRslt) bool {
+	switch {
+	case strings.Contains(r.Notes, "SSL certificate error"):
+		return false
+	case strings.Contains(r.Notes, "no such host"):
+		return false
+	case strings.Contains(r.Notes, "no site name was provided"):
+		return false
+	case strings.Contains(r.Notes, "RedirectError"):
+		return false
+	case r.Status == 999:
+		return true
+	case r.Status == 408, r.Status == 429:
+		return true
+	case r.Status >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoffDelay computes the delay before the next retry attempt: the base
+// delay doubled once per prior attempt, capped at max, with +/-25% jitter
+// to avoid a thundering herd of retries.
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+	d := base << uint(attempt-1)
+	if d <= 0 || d > max {
+		d = max
+	}
+
+	jitter := time.Duration((rand.Float64()*0.5 - 0.25) * float64(d))
+	d += jitter
+	if d < 0 {
+		d = 0
+	}
+
+	return d
+}
+
+// tokenBucket rate-limits probes to roughly N requests per second. A nil
+// *tokenBucket (the -rps default, unlimited) allows every request through.
+type tokenBucket struct {
+	tokens chan struct{}
+	stop   chan struct{}
+}
+
+// newTokenBucket starts a ticker-fed bucket allowing rps requests/sec, or
+// returns nil if rps is non-positive (no rate limiting).
+func newTokenBucket(rps float64) *tokenBucket {
+	if rps <= 0 {
+		return nil
+	}
+
+	tb := &tokenBucket{tokens: make(chan struct{}, 1), stop: make(chan struct{})}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rps))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case tb.tokens <- struct{}{}:
+				default:
+				}
+			case <-tb.stop:
+				return
+			}
+		}
+	}()
+
+	return tb
+}
+
+// Wait blocks until a token is available, or returns immediately for a nil
+// (unlimited) bucket.
+func (tb *tokenBucket) Wait() {
+	if tb == nil {
+		return
+	}
+
+	<-tb.tokens
+}
+
+// hostLimiter bounds how many probes may be in flight against a single
+// hostname at once, so an input file with many apps sitting behind the same
+// load balancer doesn't hammer it all at once. A nil *hostLimiter (the
+// -max-per-host default, unlimited) allows every request through.
+type hostLimiter struct {
+	max int
+	mu  sync.Mutex
+	sem map[string]chan struct{}
+}
+
+// newHostLimiter returns a limiter allowing max concurrent requests per
+// host, or nil if max is non-positive (no per-host limit).
+func newHostLimiter(max int) *hostLimiter {
+	if max <= 0 {
+		return nil
+	}
+
+	return &hostLimiter{max: max, sem: make(map[string]chan struct{})}
+}
+
+// acquire blocks until a slot for host is available, or returns immediately
+// for a nil (unlimited) limiter.
+func (h *hostLimiter) acquire(host string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	ch, ok := h.sem[host]
+	if !ok {
+		ch = make(chan struct{}, h.max)
+		h.sem[host] = ch
+	}
+	h.mu.Unlock()
+
+	ch <- struct{}{}
+}
+
+// release frees the slot for host acquired by a prior acquire call.
+func (h *hostLimiter) release(host string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	ch := h.sem[host]
+	h.mu.Unlock()
+
+	<-ch
+}
+
+// probeWithRetry fetches site, retrying transient failures up to `retries`
+// additional times with exponential backoff, and records how many attempts
+// were made. If ctx is cancelled (the -deadline wall-clock budget expired)
+// before or between attempts, it gives up immediately and reports that as
+// the result's Notes.
+func probeWithRetry(ctx context.Context, site string, limiter *tokenBucket, hl *hostLimiter) *reqRslt {
+	var r *reqRslt
+
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			r = &reqRslt{StartedAt: time.Now()}
+			r.fill(site, false, 999, "deadline exceeded")
+			r.Attempts = attempt
+			return r
+		}
+
+		limiter.Wait()
+
+		r = fetchSite(ctx, site, hl)
+		r.Attempts = attempt
+
+		if attempt > retries || !isRetryable(r) {
+			return r
+		}
+
+		select {
+		case <-time.After(backoffDelay(attempt, backoffBase, backoffMax)):
+		case <-ctx.Done():
+			r.fill(site, false, 999, "deadline exceeded")
+			return r
+		}
+	}
+}
+
+// worker pulls app names off jobs until it's closed, probing each one (with
+// retry/backoff/rate-limiting/per-host-limiting applied) and publishing the
+// result.
+func worker(ctx context.Context, jobs <-chan string, out chan<- *reqRslt, limiter *tokenBucket, hl *hostLimiter) {
+	defer wg.Done()
+
+	for site := range jobs {
+		out <- probeWithRetry(ctx, site, limiter, hl)
+	}
+}
+
+// resultWriter persists reqRslt values in one of the supported output
+// formats. Write is called once per result, in the order results arrive on
+// the results channel; Close flushes any buffering and must be called
+// exactly once when all results have been written.
+type resultWriter interface {
+	Write(r *reqRslt) error
+	Close() error
+}
+
+// csvResultWriter streams rows through encoding/csv as they arrive, so
+// values like Notes that contain commas or newlines are quoted correctly.
+type csvResultWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVResultWriter(w *os.File) *csvResultWriter {
+	return &csvResultWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvResultWriter) Write(r *reqRslt) error {
+	if !c.wroteHeader {
+		if err := c.w.Write([]string{"Application", "Accessible", "HTTPStatus", "Notes", "StartedAt", "Duration", "BytesRead", "URL", "Attempts", "ContentType", "ContentLength", "Title", "RedirectCount", "RedirectChain"}); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+
+	row := []string{
+		r.App,
+		fmt.Sprintf("%v", r.Accessible),
+		fmt.Sprintf("%v", r.Status),
+		r.Notes,
+		r.StartedAt.Format(time.RFC3339),
+		r.Duration.String(),
+		fmt.Sprintf("%v", r.BytesRead),
+		r.URL,
+		fmt.Sprintf("%v", r.Attempts),
+		r.ContentType,
+		fmt.Sprintf("%v", r.ContentLength),
+		r.Title,
+		fmt.Sprintf("%v", len(r.Redirects)),
+		formatRedirectChain(r.Redirects),
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatRedirectChain condenses a redirect chain into a single
+// "status Location -> status Location" string, so the per-hop trail a
+// redirect-following probe records is visible in the default CSV output
+// and not just in -format json/ndjson.
+func formatRedirectChain(hops []RedirectHop) string {
+	if len(hops) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(hops))
+	for i, h := range hops {
+		parts[i] = fmt.Sprintf("%d %v", h.Status, h.Location)
+	}
+	return strings.Join(parts, " -> ")
+}
+
+func (c *csvResultWriter) Close() error {
+	return nil
+}
+
+// jsonResultWriter buffers every result and emits a single JSON array on
+// Close, since a valid JSON array can't be streamed one element at a time.
+type jsonResultWriter struct {
+	w       *os.File
+	results []*reqRslt
+}
+
+func newJSONResultWriter(w *os.File) *jsonResultWriter {
+	return &jsonResultWriter{w: w}
+}
+
+func (j *jsonResultWriter) Write(r *reqRslt) error {
+	j.results = append(j.results, r)
+	return nil
+}
+
+func (j *jsonResultWriter) Close() error {
+	b, err := json.MarshalIndent(j.results, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
+
+// ndjsonResultWriter writes one JSON-encoded reqRslt per line as each result
+// arrives on the channel, rather than buffering until every app has been
+// processed.
+type ndjsonResultWriter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONResultWriter(w *os.File) *ndjsonResultWriter {
+	return &ndjsonResultWriter{enc: json.NewEncoder(w)}
+}
+
+func (n *ndjsonResultWriter) Write(r *reqRslt) error {
+	return n.enc.Encode(r)
+}
+
+func (n *ndjsonResultWriter) Close() error {
+	return nil
+}
+
+// newResultWriter builds the resultWriter named by format, writing to w.
+func newResultWriter(format string, w *os.File) (resultWriter, error) {
+	switch format {
+	case "csv":
+		return newCSVResultWriter(w), nil
+	case "json":
+		return newJSONResultWriter(w), nil
+	case "ndjson":
+		return newNDJSONResultWriter(w), nil
+	}
+
+	return nil, fmt.Errorf("unrecognized output format: %v", format)
 }
 
 func main() {
 	fmt.Printf("\n\n*********************************\nINFO: Start processing job\n---------------------------------\n\n")
 
+	// Register the built-in detectors, in the order they should be tried
+	detectors = append(detectors, avantErrDetector{}, herokuErrDetector{}, herokuWelDetector{}, herokuRedirectErrDetector{})
+
+	flag.StringVar(&sigFile, "sig-file", "", "path to a YAML/JSON signature file of additional detection rules")
+	flag.StringVar(&format, "format", "csv", "result output format: csv, json, or ndjson")
+	flag.StringVar(&outFile, "output", "", "file to write results to (defaults to stdout)")
+	flag.IntVar(&concurrency, "concurrency", 20, "number of apps to probe concurrently")
+	flag.Float64Var(&rps, "rps", 0, "max requests/sec across all workers (0 = unlimited)")
+	flag.IntVar(&retries, "retries", 2, "number of retries for transient failures")
+	flag.DurationVar(&backoffBase, "backoff-base", 250*time.Millisecond, "base delay before the first retry")
+	flag.DurationVar(&backoffMax, "backoff-max", 10*time.Second, "maximum delay between retries")
+	flag.IntVar(&maxRedirects, "max-redirects", 10, "maximum number of redirects to follow")
+	flag.BoolVar(&noFollow, "no-follow", false, "return the first response verbatim instead of following redirects")
+	flag.StringVar(&method, "method", "get", "probe method: get, head, or smart (HEAD first, GET only if it looks worth it)")
+	flag.Int64Var(&maxBody, "max-body", 5*1024*1024, "max response body size (bytes) to read and classify; in -method smart also the Content-Length above which the GET is skipped")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "timeout for a single probe attempt (HEAD+GET together in -method smart); each retry gets a fresh one (0 = unlimited)")
+	flag.DurationVar(&deadline, "deadline", 0, "overall wall-clock budget for the run; remaining jobs are reported as \"deadline exceeded\" once it expires (0 = unlimited)")
+	flag.IntVar(&maxPerHost, "max-per-host", 0, "max in-flight requests to any single hostname (0 = unlimited)")
+	flag.BoolVar(&debugHTTP, "debug-http", false, "record request/response dumps and DNS/TCP/TLS/TTFB timings to -debug-dir (Authorization/Cookie headers are redacted)")
+	flag.StringVar(&debugDir, "debug-dir", "debug", "directory for rotating -debug-http dump logs")
+	flag.Parse()
+
+	rand.Seed(time.Now().UnixNano())
+
+	switch method {
+	case "get", "head", "smart":
+	default:
+		fmt.Printf("ERROR: unrecognized -method %q (want get, head, or smart)\n", method)
+		os.Exit(1)
+	}
+
+	if concurrency < 1 {
+		fmt.Printf("ERROR: -concurrency must be at least 1, got %v\n", concurrency)
+		os.Exit(1)
+	}
+
+	if debugHTTP {
+		var derr error
+		if dbgLogger, derr = newDebugLogger(debugDir); derr != nil {
+			fmt.Printf("ERROR: error occurred creating -debug-dir. See: %v\n", derr)
+			os.Exit(1)
+		}
+	}
+
 	// Grab file information to be processed
-	if args = os.Args; len(args) != 2 {
+	if args = flag.Args(); len(args) != 1 {
 		// Missing filename parameter
 		fmt.Printf("ERROR: Missing filename parameter\n")
 		os.Exit(1)
 	}
 
+	// Load any user-supplied signature rules
+	if len(sigFile) > 0 {
+		sigDetector, serr := loadSignatureFile(sigFile)
+		if serr != nil {
+			fmt.Printf("ERROR: error occurred loading signature file. See: %v\n", serr)
+			os.Exit(1)
+		}
+		detectors = append(detectors, sigDetector)
+	}
+
+	// Resolve the output destination before doing any work, so a bad
+	// -format/-output combination fails fast
+	out := os.Stdout
+	if len(outFile) > 0 {
+		if out, err = os.Create(outFile); err != nil {
+			fmt.Printf("ERROR: error occurred creating output file. See: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+
+	var rw resultWriter
+	if rw, err = newResultWriter(format, out); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Read file of Heroku apps into a slice
-	if inFile, err = os.Open(args[1]); err != nil {
+	if inFile, err = os.Open(args[0]); err != nil {
 		// Error occurred opening file of heroku apps
 		fmt.Printf("ERROR: error occurred opening input file. See: %v\n", err)
 		os.Exit(1)
@@ -224,41 +1165,51 @@ func main() {
 	fmt.Printf("*********************************\nINFO: Read in %v URLS to fetch\n---------------------------------\n\n", len(apps))
 
 	chn := make(chan *reqRslt, len(apps))
+	jobs := make(chan string, len(apps))
+	limiter := newTokenBucket(rps)
+	hl := newHostLimiter(maxPerHost)
 
-	fmt.Printf("**********************************************************\nINFO: Starting %v goroutines to get responses from %v URLs\n-------------------------------------------------------------\n", len(apps), len(apps))
-
-	// Iterate through the list of apps
-	for i := 0; i < len(apps); i++ {
-		wg.Add(1)                // Account for a new goroutine
-		go procApp(apps[i], chn) // Spin up a goroutine to process an app reference
-		fmt.Printf("go routine: starting #%v of %v for site: %v\n", i+1, len(apps), apps[i])
+	ctx := context.Background()
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
 	}
 
-	// Wait for all goroutines to stop processing
-	fmt.Printf("\n\n*********************************\nINFO: All goroutines have been fired. Now wait for them to complete. %v\n---------------------------------\n\n", time.Now())
-	wg.Wait()
+	fmt.Printf("**********************************************************\nINFO: Starting %v workers to get responses from %v URLs\n-------------------------------------------------------------\n", concurrency, len(apps))
 
-	fmt.Printf("*********************************\nINFO: All goroutines have now ended. %v\n---------------------------------\n\n", time.Now())
+	// Start a bounded pool of workers rather than one goroutine per app, so
+	// a large input file can't exhaust file descriptors
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1) // Account for a new worker
+		go worker(ctx, jobs, chn, limiter, hl)
+	}
 
-	// Take a pause and wait on user input to proceed
-	fmt.Printf("******************************************************************\nINFO: Taking a quick pause. Type something and hit enter to resume the program:\n\n")
-	reader := bufio.NewReader(os.Stdin)
-	var text string
-	for {
-		text, _ = reader.ReadString('\n')
-		if len(text) != 0 {
-			break
-		}
+	// Feed every app into the jobs channel; workers pick these up as they free up
+	for i := 0; i < len(apps); i++ {
+		jobs <- apps[i]
 	}
+	close(jobs)
 
-	fmt.Printf("\n\n*********************************\nINFO: Printing out the results.\n---------------------------------\n")
+	fmt.Printf("\n\n*********************************\nINFO: All jobs have been queued. Writing results as they arrive. %v\n---------------------------------\n\n", time.Now())
 
-	// Print out results
-	fmt.Printf("Application,Accessible,HTTP Status,Notes\n")
+	// Write each result as it arrives on the channel rather than buffering
+	// until every goroutine has finished
 	for i := 0; i < len(apps); i++ {
 		v := <-chn
-		fmt.Printf("%v,%v,%v,%v\n", v.App, v.Accessible, v.Status, v.Notes)
+		if werr := rw.Write(v); werr != nil {
+			fmt.Printf("ERROR: error occurred writing a result. See: %v\n", werr)
+			os.Exit(1)
+		}
 	}
 
+	if err = rw.Close(); err != nil {
+		fmt.Printf("ERROR: error occurred finalizing results output. See: %v\n", err)
+		os.Exit(1)
+	}
+
+	// All results are in hand; this is now just cleanup
+	wg.Wait()
+
 	fmt.Printf("\n\n*********************************\nINFO: complete processing\n---------------------------------\n\n")
 }
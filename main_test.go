@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		r    reqRslt
+		want bool
+	}{
+		{"ssl certificate error", reqRslt{Status: 999, Notes: "SSL certificate error: x509: certificate signed by unknown authority"}, false},
+		{"no such host", reqRslt{Status: 999, Notes: "no such host"}, false},
+		{"no site name provided", reqRslt{Status: 999, Notes: "no site name was provided"}, false},
+		{"redirect stopped", reqRslt{Status: 999, Notes: "RedirectError: stopped after 10 redirects"}, false},
+		{"other transport error", reqRslt{Status: 999, Notes: "connection reset by peer"}, true},
+		{"408", reqRslt{Status: 408}, true},
+		{"429", reqRslt{Status: 429}, true},
+		{"500", reqRslt{Status: 500}, true},
+		{"503", reqRslt{Status: 503}, true},
+		{"200", reqRslt{Status: 200}, false},
+		{"404", reqRslt{Status: 404}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isRetryable(&c.r); got != c.want {
+				t.Errorf("isRetryable(%+v) = %v, want %v", c.r, got, c.want)
+			}
+		})
+	}
+}
+
+func TestFormatRedirectChain(t *testing.T) {
+	cases := []struct {
+		name string
+		hops []RedirectHop
+		want string
+	}{
+		{"no hops", nil, ""},
+		{"one hop", []RedirectHop{{Status: 302, Location: "https://example.com/maintenance"}}, "302 https://example.com/maintenance"},
+		{
+			"multiple hops",
+			[]RedirectHop{
+				{Status: 301, Location: "https://example.com/a"},
+				{Status: 302, Location: "https://example.com/b"},
+			},
+			"301 https://example.com/a -> 302 https://example.com/b",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := formatRedirectChain(c.hops); got != c.want {
+				t.Errorf("formatRedirectChain(%+v) = %q, want %q", c.hops, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	max := 2 * time.Second
+
+	// Jitter is +/-25%, so bound each expected value accordingly.
+	withJitter := func(d time.Duration) (time.Duration, time.Duration) {
+		return d - d/4, d + d/4
+	}
+
+	cases := []struct {
+		name    string
+		attempt int
+		want    time.Duration
+	}{
+		{"attempt 1", 1, base},
+		{"attempt 2", 2, 2 * base},
+		{"attempt 3", 3, 4 * base},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lo, hi := withJitter(c.want)
+			for i := 0; i < 50; i++ {
+				d := backoffDelay(c.attempt, base, max)
+				if d < lo || d > hi {
+					t.Fatalf("backoffDelay(%d, %v, %v) = %v, want within [%v, %v]", c.attempt, base, max, d, lo, hi)
+				}
+			}
+		})
+	}
+
+	t.Run("capped at max", func(t *testing.T) {
+		lo, hi := withJitter(max)
+		for i := 0; i < 50; i++ {
+			d := backoffDelay(10, base, max)
+			if d < lo || d > hi {
+				t.Fatalf("backoffDelay(10, %v, %v) = %v, want within [%v, %v]", base, max, d, lo, hi)
+			}
+		}
+	})
+
+	t.Run("never negative", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			if d := backoffDelay(1, base, max); d < 0 {
+				t.Fatalf("backoffDelay returned negative duration: %v", d)
+			}
+		}
+	})
+}